@@ -0,0 +1,50 @@
+package main
+
+import "testing"
+
+func TestDomainOf(t *testing.T) {
+	cases := map[string]string{
+		"user@Example.COM": "example.com",
+		"user@example.com": "example.com",
+		"malformed":        otherBucket,
+	}
+	for address, want := range cases {
+		if got := domainOf(address); got != want {
+			t.Errorf("domainOf(%q) = %q, want %q", address, got, want)
+		}
+	}
+}
+
+func TestBoundCardinalityFoldsIntoOther(t *testing.T) {
+	records := []messageLabels{
+		{senderDomain: "a.com", recipientDomain: "x.com", reasonClass: "none"},
+		{senderDomain: "a.com", recipientDomain: "x.com", reasonClass: "none"},
+		{senderDomain: "b.com", recipientDomain: "y.com", reasonClass: "none"},
+		{senderDomain: "c.com", recipientDomain: "z.com", reasonClass: "none"},
+	}
+
+	bounded := boundCardinality(records, 1)
+
+	if got := bounded[0].senderDomain; got != "a.com" {
+		t.Errorf("bounded[0].senderDomain = %q, want the top sender domain %q", got, "a.com")
+	}
+	if got := bounded[2].senderDomain; got != otherBucket {
+		t.Errorf("bounded[2].senderDomain = %q, want %q", got, otherBucket)
+	}
+	if got := bounded[3].recipientDomain; got != otherBucket {
+		t.Errorf("bounded[3].recipientDomain = %q, want %q", got, otherBucket)
+	}
+}
+
+func TestTopValuesBreaksTiesByName(t *testing.T) {
+	records := []messageLabels{
+		{senderDomain: "b.com"},
+		{senderDomain: "a.com"},
+	}
+
+	top := topValues(records, func(m messageLabels) string { return m.senderDomain }, 1)
+
+	if _, ok := top["a.com"]; !ok {
+		t.Errorf("topValues with a tie should keep the lexicographically first value, got %v", top)
+	}
+}
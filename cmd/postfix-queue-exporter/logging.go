@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/alecthomas/kingpin/v2"
+)
+
+var logLevelFlag = kingpin.Flag("log.level", "Minimum log level to output: debug, info, warn, or error.").Default("info").String()
+
+// logger is the exporter's structured logger. It is replaced in main()
+// once flags have been parsed, so any package-level initialization
+// that needs to log should happen after kingpin.Parse().
+var logger = slog.Default()
+
+func newLogger(level string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid -log.level %q: %w", level, err)
+	}
+	return slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: lvl})), nil
+}
+
+// gokitLogger adapts our slog.Logger to the go-kit log.Logger interface
+// expected by github.com/prometheus/exporter-toolkit/web, so that
+// library's own diagnostics (TLS handshake failures, etc.) flow through
+// the same structured logger as the rest of the exporter.
+type gokitLogger struct {
+	l *slog.Logger
+}
+
+// gokitLevels maps the string form of a go-kit log/level keyval to the
+// matching slog level, so messages exporter-toolkit logs at e.g. "warn"
+// or "error" are still subject to our -log.level filtering instead of
+// all being reported as Info.
+var gokitLevels = map[string]slog.Level{
+	"debug": slog.LevelDebug,
+	"info":  slog.LevelInfo,
+	"warn":  slog.LevelWarn,
+	"error": slog.LevelError,
+}
+
+func (g gokitLogger) Log(keyvals ...interface{}) error {
+	var msg string
+	lvl := slog.LevelInfo
+	attrs := make([]any, 0, len(keyvals))
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		key := fmt.Sprint(keyvals[i])
+		switch key {
+		case "msg", "message":
+			msg = fmt.Sprint(keyvals[i+1])
+			continue
+		case "level":
+			if l, ok := gokitLevels[fmt.Sprint(keyvals[i+1])]; ok {
+				lvl = l
+			}
+			continue
+		}
+		attrs = append(attrs, key, keyvals[i+1])
+	}
+	g.l.Log(context.Background(), lvl, msg, attrs...)
+	return nil
+}
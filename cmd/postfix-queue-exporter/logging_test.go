@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestGokitLoggerLogDispatchesByLevel(t *testing.T) {
+	cases := []struct {
+		name     string
+		keyvals  []interface{}
+		wantText string
+	}{
+		{"debug", []interface{}{"level", "debug", "msg", "hello"}, "level=DEBUG"},
+		{"info", []interface{}{"level", "info", "msg", "hello"}, "level=INFO"},
+		{"warn", []interface{}{"level", "warn", "msg", "hello"}, "level=WARN"},
+		{"error", []interface{}{"level", "error", "msg", "hello"}, "level=ERROR"},
+		{"no level defaults to info", []interface{}{"msg", "hello"}, "level=INFO"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			l := gokitLogger{slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))}
+
+			if err := l.Log(tc.keyvals...); err != nil {
+				t.Fatalf("Log: %v", err)
+			}
+
+			if got := buf.String(); !strings.Contains(got, tc.wantText) {
+				t.Errorf("log output %q does not contain %q", got, tc.wantText)
+			}
+		})
+	}
+}
+
+// TestGokitLoggerLogRespectsHandlerLevel guards the original bug: a
+// warn/error keyval hardcoded to Info would be silently dropped by a
+// handler configured with -log.level=warn.
+func TestGokitLoggerLogRespectsHandlerLevel(t *testing.T) {
+	var buf bytes.Buffer
+	l := gokitLogger{slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelWarn}))}
+
+	if err := l.Log("level", "info", "msg", "should be dropped"); err != nil {
+		t.Fatalf("Log: %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("an info-level message should be dropped by a warn-level handler, got %q", buf.String())
+	}
+
+	if err := l.Log("level", "error", "msg", "should surface"); err != nil {
+		t.Fatalf("Log: %v", err)
+	}
+	if !strings.Contains(buf.String(), "should surface") {
+		t.Errorf("an error-level message should surface through a warn-level handler, got %q", buf.String())
+	}
+}
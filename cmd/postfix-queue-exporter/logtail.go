@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// logSource identifies where Postfix log lines are read from.
+type logSource string
+
+const (
+	logSourceFile    logSource = "file"
+	logSourceJournal logSource = "journald"
+)
+
+// Regular expressions for the handful of postfix(8) log lines we care
+// about. They are deliberately loose about the syslog prefix so that
+// both classic syslog and journalctl's "cat" output format match.
+//
+// cleanupRecordRE is anchored to the "message-id=" field cleanup logs
+// exactly once per accepted message, rather than just any cleanup line
+// carrying a queue id: sites with header/body_checks warnings or
+// milter-reject logging emit several queue-id-bearing cleanup lines per
+// message, and matching all of them would overcount
+// postfix_cleanup_messages_processed_total.
+var (
+	cleanupRecordRE = regexp.MustCompile(`postfix/cleanup\[\d+\]: \w+: message-id=`)
+	cleanupRejectRE = regexp.MustCompile(`postfix/cleanup\[\d+\]: \w+: reject:`)
+	qmgrInsertRE    = regexp.MustCompile(`postfix/qmgr\[\d+\]: \w+: from=<[^>]*>, size=(\d+), nrcpt=\d+`)
+	deliveryDelayRE = regexp.MustCompile(`postfix/(smtp|lmtp|pipe|local)\[\d+\]: \w+: .*delays=([0-9.]+)/([0-9.]+)/([0-9.]+)/([0-9.]+)`)
+)
+
+// delayStages are, in order, the four components Postfix reports in a
+// "delays=a/b/c/d" field: time before entering the queue manager, time
+// spent in the queue manager, time to set up the delivery connection,
+// and the transmission itself.
+var delayStages = []string{"before_queue_manager", "queue_manager", "connection_setup", "transmission"}
+
+// LogTailCollector derives delivery metrics that the showq socket
+// cannot provide (rejects, per-stage delay distributions) by tailing
+// Postfix's own log output. Unlike PostfixCollector, which dials showq
+// fresh on every scrape, LogTailCollector runs a long-lived background
+// reader that updates its metric vectors as lines arrive; Collect only
+// ever reports the values accumulated so far.
+type LogTailCollector struct {
+	cleanupProcessed prometheus.Counter
+	cleanupRejected  prometheus.Counter
+	deliveryDelay    *prometheus.HistogramVec
+	qmgrInsertedSize prometheus.Histogram
+}
+
+func NewLogTailCollector() *LogTailCollector {
+	return &LogTailCollector{
+		cleanupProcessed: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "postfix_cleanup_messages_processed_total",
+			Help: "Total number of messages processed by the cleanup daemon.",
+		}),
+		cleanupRejected: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "postfix_cleanup_messages_rejected_total",
+			Help: "Total number of messages rejected by the cleanup daemon.",
+		}),
+		deliveryDelay: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "postfix_delivery_delay_seconds",
+			Help:    "Delivery delay in seconds, broken down by transport and delay stage.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"transport", "stage"}),
+		qmgrInsertedSize: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "postfix_qmgr_messages_inserted_size_bytes",
+			Help:    "Size in bytes of messages inserted into the queue by qmgr.",
+			Buckets: prometheus.ExponentialBuckets(1024, 4, 10),
+		}),
+	}
+}
+
+func (c *LogTailCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.cleanupProcessed.Desc()
+	ch <- c.cleanupRejected.Desc()
+	c.deliveryDelay.Describe(ch)
+	ch <- c.qmgrInsertedSize.Desc()
+}
+
+func (c *LogTailCollector) Collect(ch chan<- prometheus.Metric) {
+	ch <- c.cleanupProcessed
+	ch <- c.cleanupRejected
+	c.deliveryDelay.Collect(ch)
+	ch <- c.qmgrInsertedSize
+}
+
+// Run tails the configured log source until ctx is cancelled,
+// reconnecting (e.g. across log rotation) whenever the reader exits
+// with an error. It is meant to be started in its own goroutine.
+func (c *LogTailCollector) Run(ctx context.Context, source logSource, path, journalUnit string) {
+	for {
+		var err error
+		switch source {
+		case logSourceJournal:
+			err = c.tailJournal(ctx, journalUnit)
+		default:
+			err = c.tailFile(ctx, path)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			logger.Warn("postfix log tail failed, retrying", "err", err, "retry_in", "5s")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+// tailFile follows path in the manner of `tail -F`, transparently
+// picking up the new file after rotation (the underlying command
+// handles reopening by name).
+func (c *LogTailCollector) tailFile(ctx context.Context, path string) error {
+	cmd := exec.CommandContext(ctx, "tail", "-F", "-n", "0", path)
+	return c.consume(cmd)
+}
+
+// tailJournal follows the journal entries for journalUnit, which is
+// typically "postfix@-.service" or "postfix.service" depending on
+// distribution.
+func (c *LogTailCollector) tailJournal(ctx context.Context, journalUnit string) error {
+	cmd := exec.CommandContext(ctx, "journalctl", "-f", "-n", "0", "-o", "cat", "-u", journalUnit)
+	return c.consume(cmd)
+}
+
+func (c *LogTailCollector) consume(cmd *exec.Cmd) error {
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		c.handleLine(scanner.Text())
+	}
+	if err := scanner.Err(); err != nil && err != io.EOF {
+		cmd.Wait()
+		return err
+	}
+	return cmd.Wait()
+}
+
+func (c *LogTailCollector) handleLine(line string) {
+	switch {
+	case cleanupRejectRE.MatchString(line):
+		c.cleanupRejected.Inc()
+	case cleanupRecordRE.MatchString(line):
+		c.cleanupProcessed.Inc()
+	}
+
+	if m := qmgrInsertRE.FindStringSubmatch(line); m != nil {
+		if size, err := strconv.ParseFloat(m[1], 64); err == nil {
+			c.qmgrInsertedSize.Observe(size)
+		}
+	}
+
+	if m := deliveryDelayRE.FindStringSubmatch(line); m != nil {
+		transport := m[1]
+		for i, stage := range delayStages {
+			delay, err := strconv.ParseFloat(m[2+i], 64)
+			if err != nil {
+				continue
+			}
+			c.deliveryDelay.WithLabelValues(transport, stage).Observe(delay)
+		}
+	}
+}
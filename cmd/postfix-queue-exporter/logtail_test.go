@@ -0,0 +1,110 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func histogramSumCount(t *testing.T, g prometheus.Metric) (sum float64, count uint64) {
+	t.Helper()
+	var m dto.Metric
+	if err := g.Write(&m); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	return m.GetHistogram().GetSampleSum(), m.GetHistogram().GetSampleCount()
+}
+
+func TestHandleLineCleanupAccept(t *testing.T) {
+	c := NewLogTailCollector()
+	c.handleLine(`Jul 27 00:00:00 mail postfix/cleanup[12345]: A1B2C3D4E5: message-id=<1234@example.com>`)
+
+	if got := testutil.ToFloat64(c.cleanupProcessed); got != 1 {
+		t.Errorf("cleanupProcessed = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(c.cleanupRejected); got != 0 {
+		t.Errorf("cleanupRejected = %v, want 0", got)
+	}
+}
+
+func TestHandleLineCleanupReject(t *testing.T) {
+	c := NewLogTailCollector()
+	c.handleLine(`Jul 27 00:00:01 mail postfix/cleanup[12345]: A1B2C3D4E5: reject: header Subject from unknown[1.2.3.4]; from=<a@b.com> to=<c@d.com> proto=SMTP helo=<x>: 5.7.1 blocked`)
+
+	if got := testutil.ToFloat64(c.cleanupRejected); got != 1 {
+		t.Errorf("cleanupRejected = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(c.cleanupProcessed); got != 0 {
+		t.Errorf("cleanupProcessed = %v, want 0", got)
+	}
+}
+
+// TestHandleLineCleanupDoesNotOvercountWarnings guards against the
+// overcounting bug where any cleanup line carrying a queue id (e.g. a
+// header_checks warning logged before the real completion line) was
+// mistaken for a processed message.
+func TestHandleLineCleanupDoesNotOvercountWarnings(t *testing.T) {
+	c := NewLogTailCollector()
+	c.handleLine(`Jul 27 00:00:00 mail postfix/cleanup[12345]: A1B2C3D4E5: warning: header Subject: free money from unknown[1.2.3.4];`)
+	c.handleLine(`Jul 27 00:00:01 mail postfix/cleanup[12345]: A1B2C3D4E5: message-id=<1234@example.com>`)
+
+	if got := testutil.ToFloat64(c.cleanupProcessed); got != 1 {
+		t.Errorf("cleanupProcessed = %v, want 1 (only the message-id completion line should count)", got)
+	}
+}
+
+func TestHandleLineQmgrInsert(t *testing.T) {
+	cases := []struct {
+		line string
+		size float64
+	}{
+		{`Jul 27 00:00:03 mail postfix/qmgr[23456]: A1B2C3D4E5: from=<a@b.com>, size=4821, nrcpt=1 (queue active)`, 4821},
+		{`Jul 27 00:00:04 mail postfix/qmgr[23456]: B2C3D4E5F6: from=<a@b.com>, size=512, nrcpt=3 (queue active)`, 512},
+	}
+
+	c := NewLogTailCollector()
+	var wantSum float64
+	for _, tc := range cases {
+		c.handleLine(tc.line)
+		wantSum += tc.size
+	}
+
+	sum, count := histogramSumCount(t, c.qmgrInsertedSize)
+	if count != uint64(len(cases)) {
+		t.Errorf("qmgrInsertedSize count = %d, want %d", count, len(cases))
+	}
+	if sum != wantSum {
+		t.Errorf("qmgrInsertedSize sum = %v, want %v", sum, wantSum)
+	}
+}
+
+func TestHandleLineDeliveryDelay(t *testing.T) {
+	cases := []struct {
+		transport string
+		line      string
+	}{
+		{"smtp", `Jul 27 00:00:04 mail postfix/smtp[34567]: A1B2C3D4E5: to=<c@d.com>, relay=mx.example.com[5.6.7.8]:25, delay=1.2, delays=0.1/0.01/0.5/0.59, dsn=2.0.0, status=sent (250 2.0.0 Ok: queued)`},
+		{"lmtp", `Jul 27 00:00:05 mail postfix/lmtp[34568]: A1B2C3D4E5: to=<c@d.com>, relay=dovecot, delay=0.5, delays=0.05/0/0.1/0.35, dsn=2.0.0, status=sent`},
+		{"pipe", `Jul 27 00:00:06 mail postfix/pipe[34569]: A1B2C3D4E5: to=<c@d.com>, relay=procmail, delay=0.3, delays=0.02/0/0/0.28, dsn=2.0.0, status=sent`},
+		{"local", `Jul 27 00:00:07 mail postfix/local[34570]: A1B2C3D4E5: to=<c@d.com>, relay=local, delay=0.1, delays=0.01/0/0/0.09, dsn=2.0.0, status=sent`},
+	}
+
+	c := NewLogTailCollector()
+	for _, tc := range cases {
+		c.handleLine(tc.line)
+	}
+
+	for _, tc := range cases {
+		for _, stage := range delayStages {
+			obs, err := c.deliveryDelay.GetMetricWithLabelValues(tc.transport, stage)
+			if err != nil {
+				t.Fatalf("GetMetricWithLabelValues(%q, %q): %v", tc.transport, stage, err)
+			}
+			if _, count := histogramSumCount(t, obs.(prometheus.Metric)); count != 1 {
+				t.Errorf("transport=%s stage=%s count = %d, want 1", tc.transport, stage, count)
+			}
+		}
+	}
+}
@@ -0,0 +1,404 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/exporter-toolkit/web"
+	"github.com/prometheus/exporter-toolkit/web/kingpinflag"
+)
+
+// defaultShowqPath is used when neither -postfix.showq-path nor
+// -postfix.spool-dir is given.
+const defaultShowqPath = "/var/spool/postfix/public/showq"
+
+// collectMode selects how PostfixCollector obtains queue contents.
+type collectMode string
+
+const (
+	modeSocket           collectMode = "socket"
+	modePostqueueJSON    collectMode = "postqueue-json"
+	modePostqueueSummary collectMode = "postqueue-summary"
+	modeAuto             collectMode = "auto"
+)
+
+var (
+	webConfig     = kingpinflag.AddFlags(kingpin.CommandLine, ":9154")
+	telemetryPath = kingpin.Flag("web.telemetry-path", "Path under which to expose metrics.").Default("/metrics").String()
+
+	showqPathFlag = kingpin.Flag("postfix.showq-path", "Path to the Postfix showq socket. Defaults to public/showq under -postfix.spool-dir, or "+defaultShowqPath+" if that is also unset.").Default("").String()
+	spoolDirFlag  = kingpin.Flag("postfix.spool-dir", "Path to the Postfix spool directory, used to derive -postfix.showq-path when it is not set explicitly.").Default("").String()
+
+	logSourceFlag  = kingpin.Flag("postfix.log-source", "Tail Postfix logs for per-stage delivery metrics: \"file\", \"journald\", or empty to disable.").Default("").String()
+	logPathFlag    = kingpin.Flag("postfix.log-path", "Path to the Postfix log file, used when -postfix.log-source=file.").Default("/var/log/mail.log").String()
+	logJournalFlag = kingpin.Flag("postfix.log-journal-unit", "systemd unit to tail, used when -postfix.log-source=journald.").Default("postfix.service").String()
+
+	postqueueModeFlag = kingpin.Flag("postfix.mode", "How to read the Postfix queue: \"socket\", \"postqueue-json\", \"postqueue-summary\", or \"auto\".").Default(string(modeAuto)).String()
+	postqueueCmdFlag  = kingpin.Flag("postfix.postqueue-path", "Path to the postqueue binary, used by the postqueue-json and postqueue-summary modes.").Default("postqueue").String()
+	postqueueTimeout  = kingpin.Flag("postfix.postqueue-timeout", "Timeout for invoking postqueue and for dialing/reading the showq socket.").Default("5s").Duration()
+
+	nativeHistogramBucketFactor = kingpin.Flag("postfix.native-histogram-bucket-factor", "Growth factor between adjacent native histogram buckets for postfix_queue_message_age_seconds and postfix_queue_message_size_bytes (1.1 corresponds to native histogram schema 3).").Default("1.1").Float64()
+	nativeHistogramMaxBuckets   = kingpin.Flag("postfix.native-histogram-max-buckets", "Maximum number of populated buckets for the native histograms before Prometheus client-side resolution reduction kicks in.").Default("160").Int()
+
+	labelBreakdownFlag     = kingpin.Flag("postfix.label-breakdown", "Enable the opt-in postfix_queue_messages collector broken down by sender domain, recipient domain, and reason class. High cardinality; disabled by default.").Default("false").Bool()
+	labelBreakdownTopNFlag = kingpin.Flag("postfix.label-breakdown-top-n", "Number of most frequent values to keep per label dimension in the label breakdown collector; the rest are folded into \"__other__\".").Default("20").Int()
+)
+
+// queueStats holds the per-queue aggregates collected from whichever
+// source succeeded.
+type queueStats struct {
+	counts map[string]float64
+	sizes  map[string]float64
+	oldest map[string]int64
+}
+
+func newQueueStats() *queueStats {
+	return &queueStats{
+		counts: make(map[string]float64),
+		sizes:  make(map[string]float64),
+		oldest: make(map[string]int64),
+	}
+}
+
+type PostfixCollector struct {
+	socketPath   string
+	postqueueCmd string
+	timeout      time.Duration
+	mode         collectMode
+
+	queueLength  *prometheus.Desc
+	queueBytes   *prometheus.Desc
+	oldestMsgAge *prometheus.Desc
+	up           *prometheus.Desc
+
+	// messageAge and messageSize are native (sparse) histograms that
+	// show the full distribution per queue, which the gauges above
+	// cannot: a single 30-day-stuck message looks identical to 10,000
+	// of them under postfix_queue_oldest_message_age_seconds alone.
+	//
+	// The collector is scrape-driven and otherwise stateless, so
+	// rather than reconstruct a NewConstHistogram from bucket counts
+	// we keep these as persistent HistogramVecs and Reset() them at
+	// the start of every Collect, repopulating from the current showq
+	// snapshot. This is simpler than threading per-message samples
+	// through queueStats and has the same scrape-to-scrape semantics
+	// as the gauges. Because the same collector can be scraped by
+	// overlapping requests, histogramMu serializes the reset-populate-
+	// collect sequence so one scrape's Reset can't land in the middle
+	// of another's Observe calls.
+	histogramMu sync.Mutex
+	messageAge  *prometheus.HistogramVec
+	messageSize *prometheus.HistogramVec
+
+	// Self-observability: these describe the exporter's own scrapes
+	// rather than Postfix's queue state, so unlike the metrics above
+	// they are real, persistent metric objects rather than
+	// ConstMetrics rebuilt from scratch each Collect.
+	scrapeDuration   prometheus.Histogram
+	scrapesTotal     *prometheus.CounterVec
+	showqParseErrors prometheus.Counter
+}
+
+func NewPostfixCollector(socketPath, postqueueCmd string, timeout time.Duration, mode collectMode) *PostfixCollector {
+	return &PostfixCollector{
+		socketPath:   socketPath,
+		postqueueCmd: postqueueCmd,
+		timeout:      timeout,
+		mode:         mode,
+
+		queueLength: prometheus.NewDesc(
+			"postfix_queue_length",
+			"Number of messages in the Postfix queue.",
+			[]string{"queue"}, nil,
+		),
+		queueBytes: prometheus.NewDesc(
+			"postfix_queue_bytes",
+			"Total size of messages in the queue in bytes.",
+			[]string{"queue"}, nil,
+		),
+		oldestMsgAge: prometheus.NewDesc(
+			"postfix_queue_oldest_message_age_seconds",
+			"Age of the oldest message in the queue in seconds.",
+			[]string{"queue"}, nil,
+		),
+		up: prometheus.NewDesc(
+			"postfix_up",
+			"Whether the last scrape of Postfix queue data succeeded, labeled by the source that produced it.",
+			[]string{"source"}, nil,
+		),
+
+		scrapeDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "postfix_scrape_duration_seconds",
+			Help:    "Time taken to collect Postfix queue data.",
+			Buckets: prometheus.DefBuckets,
+		}),
+		scrapesTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "postfix_scrapes_total",
+			Help: "Total number of scrapes of Postfix queue data, by result.",
+		}, []string{"result"}),
+		showqParseErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "postfix_showq_parse_errors_total",
+			Help: "Total number of malformed records encountered while parsing the showq stream.",
+		}),
+
+		messageAge: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:                            "postfix_queue_message_age_seconds",
+			Help:                            "Age distribution of messages currently in the Postfix queue, in seconds.",
+			NativeHistogramBucketFactor:     *nativeHistogramBucketFactor,
+			NativeHistogramMaxBucketNumber:  uint32(*nativeHistogramMaxBuckets),
+			NativeHistogramMinResetDuration: 0,
+		}, []string{"queue"}),
+		messageSize: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:                            "postfix_queue_message_size_bytes",
+			Help:                            "Size distribution of messages currently in the Postfix queue, in bytes.",
+			NativeHistogramBucketFactor:     *nativeHistogramBucketFactor,
+			NativeHistogramMaxBucketNumber:  uint32(*nativeHistogramMaxBuckets),
+			NativeHistogramMinResetDuration: 0,
+		}, []string{"queue"}),
+	}
+}
+
+func (c *PostfixCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.queueLength
+	ch <- c.queueBytes
+	ch <- c.oldestMsgAge
+	ch <- c.up
+	ch <- c.scrapeDuration.Desc()
+	c.scrapesTotal.Describe(ch)
+	ch <- c.showqParseErrors.Desc()
+	c.messageAge.Describe(ch)
+	c.messageSize.Describe(ch)
+}
+
+func (c *PostfixCollector) Collect(ch chan<- prometheus.Metric) {
+	// Reset, repopulation (inside gather, via collectFromSocket /
+	// collectFromPostqueueJSON), and collection of messageAge/
+	// messageSize must happen as one atomic sequence: two overlapping
+	// scrapes of the same collector would otherwise interleave their
+	// Reset and Observe calls and corrupt each other's histograms.
+	c.histogramMu.Lock()
+	defer c.histogramMu.Unlock()
+
+	start := time.Now()
+	c.messageAge.Reset()
+	c.messageSize.Reset()
+
+	stats, source, err := c.gather()
+	c.scrapeDuration.Observe(time.Since(start).Seconds())
+
+	if err != nil {
+		logger.Error("could not collect Postfix queue data", "err", err)
+		c.scrapesTotal.WithLabelValues("error").Inc()
+		ch <- prometheus.MustNewConstMetric(c.up, prometheus.GaugeValue, 0, "none")
+		c.collectSelf(ch)
+		return
+	}
+	c.scrapesTotal.WithLabelValues("success").Inc()
+	ch <- prometheus.MustNewConstMetric(c.up, prometheus.GaugeValue, 1, source)
+
+	for q, count := range stats.counts {
+		ch <- prometheus.MustNewConstMetric(c.queueLength, prometheus.GaugeValue, count, q)
+		ch <- prometheus.MustNewConstMetric(c.queueBytes, prometheus.GaugeValue, stats.sizes[q], q)
+		ch <- prometheus.MustNewConstMetric(c.oldestMsgAge, prometheus.GaugeValue, float64(stats.oldest[q]), q)
+	}
+	c.messageAge.Collect(ch)
+	c.messageSize.Collect(ch)
+	c.collectSelf(ch)
+}
+
+// collectSelf reports the exporter's own scrape metrics, which are
+// always emitted regardless of whether the scrape itself succeeded.
+func (c *PostfixCollector) collectSelf(ch chan<- prometheus.Metric) {
+	ch <- c.scrapeDuration
+	c.scrapesTotal.Collect(ch)
+	ch <- c.showqParseErrors
+}
+
+// gather dispatches to the configured source(s) and returns the
+// aggregated stats along with the name of the source that produced
+// them.
+func (c *PostfixCollector) gather() (*queueStats, string, error) {
+	switch c.mode {
+	case modeSocket:
+		stats, err := c.collectFromSocket()
+		return stats, string(modeSocket), err
+	case modePostqueueJSON:
+		stats, err := c.collectFromPostqueueJSON()
+		return stats, string(modePostqueueJSON), err
+	case modePostqueueSummary:
+		stats, err := c.collectFromPostqueueSummary()
+		return stats, string(modePostqueueSummary), err
+	default: // modeAuto
+		if stats, err := c.collectFromSocket(); err == nil {
+			return stats, string(modeSocket), nil
+		}
+		if stats, err := c.collectFromPostqueueJSON(); err == nil {
+			return stats, string(modePostqueueJSON), nil
+		}
+		stats, err := c.collectFromPostqueueSummary()
+		return stats, string(modePostqueueSummary), err
+	}
+}
+
+// collectFromSocket reads the queue contents straight from Postfix's
+// own showq socket. This is the fastest and most detailed source, but
+// requires the exporter to run where that socket is reachable.
+func (c *PostfixCollector) collectFromSocket() (*queueStats, error) {
+	conn, err := dialShowq(c.socketPath, c.timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	now := time.Now().Unix()
+	stats := newQueueStats()
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Split(splitNull)
+
+	var currentQueue string
+	var currentSize float64
+	var currentArrival int64
+
+	for scanner.Scan() {
+		key := scanner.Text()
+		if !scanner.Scan() {
+			c.showqParseErrors.Inc()
+			break
+		}
+		val := scanner.Text()
+
+		switch key {
+		case "queue_name":
+			currentQueue = val
+		case "message_size":
+			currentSize, _ = strconv.ParseFloat(val, 64)
+		case "arrival_time":
+			currentArrival, _ = strconv.ParseInt(val, 10, 64)
+		case "queue_id":
+			// A queue_id signifies a complete message record in the stream
+			stats.counts[currentQueue]++
+			stats.sizes[currentQueue] += currentSize
+
+			age := now - currentArrival
+			if age > stats.oldest[currentQueue] {
+				stats.oldest[currentQueue] = age
+			}
+			c.messageAge.WithLabelValues(currentQueue).Observe(float64(age))
+			c.messageSize.WithLabelValues(currentQueue).Observe(currentSize)
+		}
+	}
+
+	return stats, scanner.Err()
+}
+
+// splitNull handles the Postfix null-terminated binary protocol
+func splitNull(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 { return 0, nil, nil }
+	if i := bytes.IndexByte(data, 0); i >= 0 { return i + 1, data[0:i], nil }
+	return 0, nil, nil
+}
+
+// dialShowq connects to a Postfix showq endpoint. Endpoints starting
+// with "/" are treated as local unix socket paths; anything else is
+// dialed over TCP, which is how /probe reaches showq sockets forwarded
+// from other Postfix nodes (e.g. via socat or an SSH tunnel). timeout
+// bounds both the dial and the subsequent read, so a black-holed or
+// firewalled remote target can't hang the scrape indefinitely.
+func dialShowq(target string, timeout time.Duration) (net.Conn, error) {
+	network := "tcp"
+	if strings.HasPrefix(target, "/") {
+		network = "unix"
+	}
+	conn, err := net.DialTimeout(network, target, timeout)
+	if err != nil {
+		return nil, err
+	}
+	if timeout > 0 {
+		conn.SetDeadline(time.Now().Add(timeout))
+	}
+	return conn, nil
+}
+
+// derivePostfixShowqPath returns the showq socket path under a Postfix
+// spool directory.
+func derivePostfixShowqPath(spoolDir string) string {
+	return filepath.Join(spoolDir, "public", "showq")
+}
+
+// resolveShowqPath honors an explicit -postfix.showq-path, falls back
+// to deriving it from -postfix.spool-dir, and otherwise uses the
+// upstream default socket location.
+func resolveShowqPath(explicit, spoolDir string) string {
+	if explicit != "" {
+		return explicit
+	}
+	if spoolDir != "" {
+		return derivePostfixShowqPath(spoolDir)
+	}
+	return defaultShowqPath
+}
+
+// probeHandler lets a single exporter instance scrape a Postfix node
+// other than its own local one: ?target= names a showq socket path or
+// host:port, and a fresh PostfixCollector is registered against a
+// scoped registry for the duration of the request. Only the socket
+// source makes sense here, since postqueue always talks to the local
+// Postfix instance.
+func probeHandler(w http.ResponseWriter, r *http.Request) {
+	target := r.URL.Query().Get("target")
+	if target == "" {
+		http.Error(w, "target parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(NewPostfixCollector(target, *postqueueCmdFlag, *postqueueTimeout, modeSocket))
+	promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
+
+func main() {
+	kingpin.Parse()
+
+	l, err := newLogger(*logLevelFlag)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	logger = l
+
+	showqPath := resolveShowqPath(*showqPathFlag, *spoolDirFlag)
+	prometheus.MustRegister(NewPostfixCollector(showqPath, *postqueueCmdFlag, *postqueueTimeout, collectMode(*postqueueModeFlag)))
+
+	if source := logSource(*logSourceFlag); source != "" {
+		tailer := NewLogTailCollector()
+		prometheus.MustRegister(tailer)
+		go tailer.Run(context.Background(), source, *logPathFlag, *logJournalFlag)
+	}
+
+	if *labelBreakdownFlag {
+		prometheus.MustRegister(NewLabelBreakdownCollector(showqPath, *labelBreakdownTopNFlag, *postqueueTimeout))
+	}
+
+	http.Handle(*telemetryPath, promhttp.Handler())
+	http.HandleFunc("/probe", probeHandler)
+
+	server := &http.Server{}
+	logger.Info("Postfix Exporter starting")
+	if err := web.ListenAndServe(server, webConfig, gokitLogger{logger}); err != nil {
+		logger.Error("exporter exited", "err", err)
+		os.Exit(1)
+	}
+}
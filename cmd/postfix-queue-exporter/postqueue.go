@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// postqueueMessage mirrors the per-line objects emitted by
+// `postqueue -j`.
+type postqueueMessage struct {
+	QueueName   string   `json:"queue_name"`
+	MessageSize float64  `json:"message_size"`
+	ArrivalTime int64    `json:"arrival_time"`
+	Sender      string   `json:"sender"`
+	Recipients  []string `json:"recipients"`
+}
+
+// postqueueSummaryRE matches the trailing summary line of `postqueue -p`,
+// e.g. "-- 12 Kbytes in 3 Requests." or "-- 4.7 Kbytes in 2 Requests.".
+// Postfix prints no summary line at all (just "Mail queue is empty.")
+// when the queue is empty, so the absence of a match is not itself an
+// error; see collectFromPostqueueSummary.
+var postqueueSummaryRE = regexp.MustCompile(`^--\s+([0-9.]+)\s+Kbytes in\s+(\d+)\s+Requests?\.`)
+
+// collectFromPostqueueJSON shells out to `postqueue -j`, which prints
+// one JSON object per queued message. It is used when the showq socket
+// is unreachable, e.g. when the exporter runs outside the Postfix
+// chroot or as an unprivileged user.
+func (c *PostfixCollector) collectFromPostqueueJSON() (*queueStats, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, c.postqueueCmd, "-j").Output()
+	if err != nil {
+		return nil, fmt.Errorf("postqueue -j: %w", err)
+	}
+
+	now := time.Now().Unix()
+	stats := newQueueStats()
+
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var msg postqueueMessage
+		if err := json.Unmarshal(line, &msg); err != nil {
+			return nil, fmt.Errorf("parsing postqueue -j output: %w", err)
+		}
+
+		stats.counts[msg.QueueName]++
+		stats.sizes[msg.QueueName] += msg.MessageSize
+
+		age := now - msg.ArrivalTime
+		if age > stats.oldest[msg.QueueName] {
+			stats.oldest[msg.QueueName] = age
+		}
+		c.messageAge.WithLabelValues(msg.QueueName).Observe(float64(age))
+		c.messageSize.WithLabelValues(msg.QueueName).Observe(msg.MessageSize)
+	}
+
+	return stats, scanner.Err()
+}
+
+// collectFromPostqueueSummary is the least detailed fallback: it only
+// parses the trailing summary line of `postqueue -p`, so per-queue
+// breakdown and message age are unavailable. Everything is reported
+// under the synthetic queue name "all".
+//
+// When the queue is empty, Postfix prints "Mail queue is empty." and
+// no "-- N Kbytes in M Requests." line at all, so a summary line not
+// matching is the normal, healthy case, not a failure: the command
+// already exited 0 by the time we get here, so we default to an empty
+// queue rather than reporting postfix_up=0.
+func (c *PostfixCollector) collectFromPostqueueSummary() (*queueStats, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, c.postqueueCmd, "-p").Output()
+	if err != nil {
+		return nil, fmt.Errorf("postqueue -p: %w", err)
+	}
+
+	return parsePostqueueSummary(out)
+}
+
+// parsePostqueueSummary extracts the queue totals from `postqueue -p`
+// output. It is split out from collectFromPostqueueSummary so the
+// parsing can be unit tested without shelling out.
+func parsePostqueueSummary(out []byte) (*queueStats, error) {
+	var kbytes float64
+	var requests int64
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		m := postqueueSummaryRE.FindStringSubmatch(scanner.Text())
+		if m == nil {
+			continue
+		}
+		kbytes, _ = strconv.ParseFloat(m[1], 64)
+		requests, _ = strconv.ParseInt(m[2], 10, 64)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	stats := newQueueStats()
+	stats.counts["all"] = float64(requests)
+	stats.sizes["all"] = kbytes * 1024
+	return stats, nil
+}
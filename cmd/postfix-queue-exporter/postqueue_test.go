@@ -0,0 +1,42 @@
+package main
+
+import "testing"
+
+func TestParsePostqueueSummaryEmptyQueue(t *testing.T) {
+	stats, err := parsePostqueueSummary([]byte("Mail queue is empty\n"))
+	if err != nil {
+		t.Fatalf("parsePostqueueSummary: %v", err)
+	}
+	if got := stats.counts["all"]; got != 0 {
+		t.Errorf("counts[all] = %v, want 0", got)
+	}
+	if got := stats.sizes["all"]; got != 0 {
+		t.Errorf("sizes[all] = %v, want 0", got)
+	}
+}
+
+func TestParsePostqueueSummaryIntegerKbytes(t *testing.T) {
+	stats, err := parsePostqueueSummary([]byte("-- 12 Kbytes in 3 Requests.\n"))
+	if err != nil {
+		t.Fatalf("parsePostqueueSummary: %v", err)
+	}
+	if got := stats.counts["all"]; got != 3 {
+		t.Errorf("counts[all] = %v, want 3", got)
+	}
+	if got := stats.sizes["all"]; got != 12*1024 {
+		t.Errorf("sizes[all] = %v, want %v", got, 12*1024)
+	}
+}
+
+func TestParsePostqueueSummaryDecimalKbytes(t *testing.T) {
+	stats, err := parsePostqueueSummary([]byte("-- 4.7 Kbytes in 2 Requests.\n"))
+	if err != nil {
+		t.Fatalf("parsePostqueueSummary: %v", err)
+	}
+	if got := stats.counts["all"]; got != 2 {
+		t.Errorf("counts[all] = %v, want 2", got)
+	}
+	if got := stats.sizes["all"]; got != 4.7*1024 {
+		t.Errorf("sizes[all] = %v, want %v", got, 4.7*1024)
+	}
+}